@@ -0,0 +1,73 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command codama-gen reads a Codama IDL JSON file and writes a Go source
+// file of structs whose fields carry the `bin:"..."` tags that the bin
+// package's Codama tag interpreter knows how to encode/decode.
+//
+// Usage:
+//
+//	codama-gen -idl path/to/program.idl.json -out generated.go -package mypkg
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/daog1/binary/codama"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "codama-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	idlPath := flag.String("idl", "", "path to the Codama IDL JSON file")
+	outPath := flag.String("out", "", "path to write the generated Go file (defaults to stdout)")
+	packageName := flag.String("package", "main", "package name for the generated file")
+	flag.Parse()
+
+	if *idlPath == "" {
+		return fmt.Errorf("-idl is required")
+	}
+
+	raw, err := os.ReadFile(*idlPath)
+	if err != nil {
+		return fmt.Errorf("reading IDL file: %w", err)
+	}
+
+	var idl codama.IDL
+	if err := json.Unmarshal(raw, &idl); err != nil {
+		return fmt.Errorf("parsing IDL file: %w", err)
+	}
+
+	out, err := codama.Generate(&idl, *packageName)
+	if err != nil {
+		return fmt.Errorf("generating Go source: %w", err)
+	}
+
+	if *outPath == "" {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+	return os.WriteFile(*outPath, out, 0o644)
+}
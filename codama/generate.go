@@ -0,0 +1,495 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codama
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// generator accumulates the Go type declarations produced while walking an
+// IDL, plus any nested types (struct/enum payloads) discovered along the way.
+type generator struct {
+	packageName string
+	primary     []string
+	nested      []string
+}
+
+// Generate renders idl into a formatted Go source file in package
+// packageName. Every generated field whose layout differs from the default
+// encoding carries the nested `bin:"..."` tag that tags-parser.go /
+// codama_codec.go in the parent bin package know how to execute; fields that
+// use the default encoding carry no tag. The result can be encoded/decoded
+// with NewBinEncoder / NewBinDecoder without hand-writing tags.
+func Generate(idl *IDL, packageName string) ([]byte, error) {
+	g := &generator{packageName: packageName}
+
+	for _, program := range idl.Programs {
+		for _, dt := range program.DefinedTypes {
+			decl, err := g.typeDecl(goName(dt.Name), dt.Type)
+			if err != nil {
+				return nil, fmt.Errorf("defined type %q: %w", dt.Name, err)
+			}
+			g.primary = append(g.primary, decl)
+		}
+		for _, acc := range program.Accounts {
+			decl, err := g.typeDecl(goName(acc.Name), acc.Data)
+			if err != nil {
+				return nil, fmt.Errorf("account %q: %w", acc.Name, err)
+			}
+			g.primary = append(g.primary, decl)
+		}
+		for _, ix := range program.Instructions {
+			fields := make([]StructFieldNode, len(ix.Arguments))
+			for i, arg := range ix.Arguments {
+				fields[i] = StructFieldNode{Name: arg.Name, Type: arg.Type}
+			}
+			decl, err := g.typeDecl(goName(ix.Name)+"Instruction", TypeNode{Kind: "structTypeNode", Fields: fields})
+			if err != nil {
+				return nil, fmt.Errorf("instruction %q: %w", ix.Name, err)
+			}
+			g.primary = append(g.primary, decl)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by codama-gen. DO NOT EDIT.\n\npackage %s\n", g.packageName)
+	for _, decl := range g.primary {
+		out.WriteString("\n")
+		out.WriteString(decl)
+		out.WriteString("\n")
+	}
+	for _, decl := range g.nested {
+		out.WriteString("\n")
+		out.WriteString(decl)
+		out.WriteString("\n")
+	}
+
+	return format.Source(out.Bytes())
+}
+
+// typeDecl renders the top-level Go declaration for a named IDL type
+// (a definedType, an account's data, or a synthesized instruction struct).
+func (g *generator) typeDecl(name string, node TypeNode) (string, error) {
+	switch node.Kind {
+	case "structTypeNode":
+		return g.structDecl(name, node)
+	case "enumTypeNode":
+		return g.enumDecl(name, node)
+	default:
+		goType, _, err := g.fieldType(name, node)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("type %s %s", name, goType), nil
+	}
+}
+
+// structDecl renders `type name struct { ... }` for a structTypeNode.
+func (g *generator) structDecl(name string, node TypeNode) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	for _, field := range node.Fields {
+		fieldName := goName(field.Name)
+		goType, tag, err := g.fieldType(name+fieldName, field.Type)
+		if err != nil {
+			return "", fmt.Errorf("field %q: %w", field.Name, err)
+		}
+		if tag != "" {
+			fmt.Fprintf(&b, "\t%s %s `bin:%q`\n", fieldName, goType, tag)
+		} else {
+			fmt.Fprintf(&b, "\t%s %s\n", fieldName, goType)
+		}
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// enumDecl renders an enumTypeNode. Enums whose variants all carry no
+// payload (enumEmptyVariantTypeNode) become a plain `uint8` constant enum,
+// matching the existing `bin:"enum"` Borsh-enum support. Enums with at least
+// one payload-carrying variant become a struct with a discriminant field
+// plus one pointer field per payload-carrying variant (empty variants get no
+// field), so at most the active variant's field is non-nil; the
+// discriminant field's tag is
+// `enum<variant<discriminant,FieldName>,...>`, one entry per payload
+// variant, which is what drives codamaEncodeEnum/codamaDecodeEnum (wired in
+// via Encoder.encodeStruct/Decoder.decodeStruct) to touch only the field
+// matching the discriminant actually on the wire instead of all of them.
+func (g *generator) enumDecl(name string, node TypeNode) (decl string, err error) {
+	allEmpty := true
+	for _, v := range node.Variants {
+		if v.Kind != "enumEmptyVariantTypeNode" {
+			allEmpty = false
+			break
+		}
+	}
+
+	if allEmpty {
+		var b strings.Builder
+		fmt.Fprintf(&b, "type %s uint8\n\nconst (\n", name)
+		for i, v := range node.Variants {
+			if i == 0 {
+				fmt.Fprintf(&b, "\t%s%s %s = iota\n", name, goName(v.Name), name)
+			} else {
+				fmt.Fprintf(&b, "\t%s%s\n", name, goName(v.Name))
+			}
+		}
+		b.WriteString(")")
+		return b.String(), nil
+	}
+
+	kindName := name + "Kind"
+	var consts strings.Builder
+	fmt.Fprintf(&consts, "type %s uint8\n\nconst (\n", kindName)
+
+	var variantFields strings.Builder
+	var variantTags []string
+	for i, v := range node.Variants {
+		variantName := goName(v.Name)
+		if i == 0 {
+			fmt.Fprintf(&consts, "\t%s%s %s = iota\n", kindName, variantName, kindName)
+		} else {
+			fmt.Fprintf(&consts, "\t%s%s\n", kindName, variantName)
+		}
+
+		payload := v.Struct
+		if payload == nil {
+			payload = v.Tuple
+		}
+		if payload == nil {
+			continue
+		}
+		payloadName := name + variantName
+		payloadDecl, err := g.typeDecl(payloadName, *payload)
+		if err != nil {
+			return "", fmt.Errorf("enum %q variant %q: %w", name, v.Name, err)
+		}
+		g.nested = append(g.nested, payloadDecl)
+		fmt.Fprintf(&variantFields, "\t%s *%s\n", variantName, payloadName)
+		variantTags = append(variantTags, fmt.Sprintf("variant<%d,%s>", i, variantName))
+	}
+	consts.WriteString(")")
+
+	var fields strings.Builder
+	fmt.Fprintf(&fields, "type %s struct {\n\tKind %s `bin:%q`\n", name, kindName, fmt.Sprintf("enum<%s>", strings.Join(variantTags, ",")))
+	fields.WriteString(variantFields.String())
+	fields.WriteString("}")
+
+	return consts.String() + "\n\n" + fields.String(), nil
+}
+
+// fieldType resolves an IDL TypeNode into a Go field type and the bin tag
+// that reproduces its wire layout. nameHint is used to name any nested
+// struct/enum type this field needs to synthesize.
+func (g *generator) fieldType(nameHint string, node TypeNode) (goType string, tag string, err error) {
+	switch node.Kind {
+	case "boolTypeNode":
+		return "bool", "", nil
+
+	case "numberTypeNode":
+		goType, err := goNumberType(node.Format)
+		if err != nil {
+			return "", "", err
+		}
+		if node.Endian == "be" {
+			return goType, "big", nil
+		}
+		return goType, "", nil
+
+	case "stringTypeNode":
+		// Variable-length strings are assumed to already be length-prefixed
+		// by the field's default encoding; fixedSizeTypeNode below is what
+		// turns this into a fixed-width string.
+		return "string", "", nil
+
+	case "bytesTypeNode":
+		return "[]byte", "", nil
+
+	case "fixedSizeTypeNode":
+		inner := node.Type
+		if inner == nil {
+			inner = node.Item
+		}
+		if inner == nil {
+			return "", "", fmt.Errorf("fixedSizeTypeNode %q has no wrapped type", nameHint)
+		}
+		innerType, _, err := g.fieldType(nameHint, *inner)
+		if err != nil {
+			return "", "", err
+		}
+		return innerType, fmt.Sprintf("fixed_size<%d>", node.Size), nil
+
+	case "hiddenPrefixTypeNode":
+		if node.Type == nil {
+			return "", "", fmt.Errorf("hiddenPrefixTypeNode %q has no wrapped type", nameHint)
+		}
+		innerType, innerTag, err := g.fieldType(nameHint, *node.Type)
+		if err != nil {
+			return "", "", err
+		}
+		tag, err := hiddenPrefixTag(node.Prefixes, innerTag)
+		if err != nil {
+			return "", "", err
+		}
+		return innerType, tag, nil
+
+	case "optionTypeNode":
+		item := node.Item
+		if item == nil {
+			item = node.Type
+		}
+		if item == nil {
+			return "", "", fmt.Errorf("optionTypeNode %q has no item", nameHint)
+		}
+		itemType, itemTag, err := g.fieldType(nameHint, *item)
+		if err != nil {
+			return "", "", err
+		}
+		prefixTag, err := prefixFormatTag(node.Prefix)
+		if err != nil {
+			return "", "", err
+		}
+		return "*" + itemType, fmt.Sprintf("option<%s>", optionLikeArgs(prefixTag, itemTag)), nil
+
+	case "sizePrefixTypeNode":
+		if node.Type == nil {
+			return "", "", fmt.Errorf("sizePrefixTypeNode %q has no wrapped type", nameHint)
+		}
+		return g.sizePrefixed(nameHint, *node.Type, node.Prefix)
+
+	case "arrayTypeNode":
+		return g.arrayType(nameHint, node)
+
+	case "structTypeNode":
+		decl, err := g.structDecl(nameHint, node)
+		if err != nil {
+			return "", "", err
+		}
+		g.nested = append(g.nested, decl)
+		return nameHint, "", nil
+
+	case "enumTypeNode":
+		decl, err := g.enumDecl(nameHint, node)
+		if err != nil {
+			return "", "", err
+		}
+		g.nested = append(g.nested, decl)
+		return nameHint, "", nil
+
+	default:
+		return "", "", fmt.Errorf("unsupported type node kind %q", node.Kind)
+	}
+}
+
+// sizePrefixed handles a sizePrefixTypeNode: its wrapped `type` is either the
+// string/bytes it length-prefixes (handled by the field's default encoding,
+// so no nested tag is needed) or an arrayTypeNode whose count is implied by
+// the prefix (turned into a Go slice with an explicit size_prefix<> tag).
+func (g *generator) sizePrefixed(nameHint string, inner TypeNode, prefix *TypeNode) (string, string, error) {
+	if inner.Kind == "stringTypeNode" || inner.Kind == "bytesTypeNode" {
+		goType, _, err := g.fieldType(nameHint, inner)
+		return goType, "", err
+	}
+
+	item := inner.Item
+	if item == nil {
+		item = &inner
+	}
+	itemType, itemTag, err := g.fieldType(nameHint, *item)
+	if err != nil {
+		return "", "", err
+	}
+	prefixTag, err := prefixFormatTag(prefix)
+	if err != nil {
+		return "", "", err
+	}
+	return "[]" + itemType, fmt.Sprintf("size_prefix<%s>", optionLikeArgs(prefixTag, itemTag)), nil
+}
+
+// arrayType handles a bare arrayTypeNode (not wrapped in a sizePrefixTypeNode).
+func (g *generator) arrayType(nameHint string, node TypeNode) (string, string, error) {
+	if node.Item == nil {
+		return "", "", fmt.Errorf("arrayTypeNode %q has no item", nameHint)
+	}
+	itemType, itemTag, err := g.fieldType(nameHint, *node.Item)
+	if err != nil {
+		return "", "", err
+	}
+
+	if node.Count == nil {
+		return "", "", fmt.Errorf("arrayTypeNode %q has no count", nameHint)
+	}
+
+	switch node.Count.Kind {
+	case "fixedCountNode":
+		leaf := itemTagLeaf(*node.Item, itemTag)
+		return fmt.Sprintf("[%d]%s", node.Count.Value, itemType),
+			fmt.Sprintf("array<%s,%d>", leaf, node.Count.Value), nil
+	case "prefixedCountNode":
+		prefixTag, err := prefixFormatTag(node.Count.Prefix)
+		if err != nil {
+			return "", "", err
+		}
+		return "[]" + itemType, fmt.Sprintf("size_prefix<%s>", optionLikeArgs(prefixTag, itemTag)), nil
+	case "remainderCountNode":
+		return "[]" + itemType, "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported array count kind %q", node.Count.Kind)
+	}
+}
+
+// itemTagLeaf returns the identifier used as array<>'s first argument. An
+// item that resolved its own bin tag (e.g. a wrapped fixed_size<>/option<>)
+// passes that tag through verbatim so the interpreter actually applies it;
+// a plain number format is passed through by name so the interpreter can
+// ignore it (array<> only cares about the count); anything else falls back
+// to the generic placeholder "item", which the interpreter treats as "use
+// the field's default encoding".
+func itemTagLeaf(item TypeNode, itemTag string) string {
+	if itemTag != "" {
+		return itemTag
+	}
+	if item.Kind == "numberTypeNode" && item.Format != "" {
+		return item.Format
+	}
+	return "item"
+}
+
+// optionLikeArgs joins a possibly-empty prefix format tag and a
+// possibly-empty item tag into the child list option<>/size_prefix<> expect:
+// prefix first (so resolveCodamaPrefix finds it in Children[0]), then the
+// item's own tag if the wrapped field needs one. Either half may be omitted,
+// in which case the interpreter falls back to its default prefix width or
+// the field's default encoding.
+func optionLikeArgs(prefixTag, itemTag string) string {
+	switch {
+	case prefixTag != "" && itemTag != "":
+		return prefixTag + "," + itemTag
+	case prefixTag != "":
+		return prefixTag
+	default:
+		return itemTag
+	}
+}
+
+// prefixFormatTag renders a numberTypeNode used as a length/discriminant
+// prefix into the `fixed<prefix<format,endian>>` form consumed by
+// resolveCodamaPrefix. A nil prefix means "use the interpreter's default".
+func prefixFormatTag(prefix *TypeNode) (string, error) {
+	if prefix == nil {
+		return "", nil
+	}
+	if prefix.Kind != "numberTypeNode" {
+		return "", fmt.Errorf("prefix must be a numberTypeNode, got %q", prefix.Kind)
+	}
+	endian := prefix.Endian
+	if endian == "" {
+		endian = "le"
+	}
+	return fmt.Sprintf("fixed<prefix<%s,%s>>", prefix.Format, endian), nil
+}
+
+// hiddenPrefixTag folds a list of constantTypeNode prefixes into the nested
+// `hidden_prefix<constant<...>,...>` chain that codamaEncodeHiddenPrefix
+// expects, terminating with innerTag (the already-resolved tag of the
+// wrapped field, possibly empty for a field with no further modifiers).
+func hiddenPrefixTag(prefixes []TypeNode, innerTag string) (string, error) {
+	if len(prefixes) == 0 {
+		return "", fmt.Errorf("hidden_prefix requires at least one constant prefix")
+	}
+	last := len(prefixes) - 1
+	lastConstant, err := constantTag(prefixes[last])
+	if err != nil {
+		return "", err
+	}
+	tag := lastConstant
+	if innerTag != "" {
+		tag += "," + innerTag
+	}
+	for i := last - 1; i >= 0; i-- {
+		c, err := constantTag(prefixes[i])
+		if err != nil {
+			return "", err
+		}
+		tag = fmt.Sprintf("%s,hidden_prefix<%s>", c, tag)
+	}
+	return fmt.Sprintf("hidden_prefix<%s>", tag), nil
+}
+
+// constantTag renders a constantTypeNode into `constant<format,value>`.
+func constantTag(node TypeNode) (string, error) {
+	if node.Kind != "constantTypeNode" {
+		return "", fmt.Errorf("hidden_prefix entries must be constantTypeNode, got %q", node.Kind)
+	}
+	if node.Type == nil || node.Value == nil {
+		return "", fmt.Errorf("constantTypeNode is missing its type or value")
+	}
+	return fmt.Sprintf("constant<%s,%d>", node.Type.Format, node.Value.Number), nil
+}
+
+// goNumberType maps a Codama numberTypeNode format to its Go equivalent.
+func goNumberType(format string) (string, error) {
+	switch format {
+	case "u8":
+		return "uint8", nil
+	case "u16":
+		return "uint16", nil
+	case "u32":
+		return "uint32", nil
+	case "u64":
+		return "uint64", nil
+	case "i8":
+		return "int8", nil
+	case "i16":
+		return "int16", nil
+	case "i32":
+		return "int32", nil
+	case "i64":
+		return "int64", nil
+	case "f32":
+		return "float32", nil
+	case "f64":
+		return "float64", nil
+	case "u128", "i128":
+		return "[16]byte", nil
+	default:
+		return "", fmt.Errorf("unsupported number format %q", format)
+	}
+}
+
+// goName converts a Codama camelCase or snake_case identifier (e.g.
+// "tokenAccount", "mint_authority") into an exported Go identifier (e.g.
+// "TokenAccount", "MintAuthority").
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' })
+	if len(parts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]))
+		b.WriteString(p[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codama
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateExample exercises a non-trivial IDL covering enums with
+// payload variants, a nested option, and a fixed-size string, and compares
+// the generated Go source against a golden fixture byte-for-byte.
+func TestGenerateExample(t *testing.T) {
+	raw, err := os.ReadFile("testdata/example.idl.json")
+	require.NoError(t, err)
+
+	var idl IDL
+	require.NoError(t, json.Unmarshal(raw, &idl))
+
+	got, err := Generate(&idl, "generated")
+	require.NoError(t, err)
+
+	want, err := os.ReadFile("testdata/example.golden")
+	require.NoError(t, err)
+
+	require.Equal(t, string(want), string(got))
+}
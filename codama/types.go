@@ -0,0 +1,131 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codama reads a Codama IDL (https://github.com/codama-idl/codama)
+// JSON document and generates Go structs whose fields carry the nested
+// `bin:"..."` tags understood by the tag parser and interpreter in the
+// parent bin package.
+package codama
+
+// IDL is the root of a Codama IDL JSON document. Only the subset of the
+// schema needed to generate Go struct definitions is modeled here.
+type IDL struct {
+	Kind     string    `json:"kind"`
+	Programs []Program `json:"programs"`
+}
+
+// Program is a single `programNode` entry under `programs[]`.
+type Program struct {
+	Kind         string        `json:"kind"`
+	Name         string        `json:"name"`
+	Accounts     []Account     `json:"accounts"`
+	DefinedTypes []DefinedType `json:"definedTypes"`
+	Instructions []Instruction `json:"instructions"`
+}
+
+// DefinedType is a `definedTypeNode`: a named, reusable type.
+type DefinedType struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Type TypeNode `json:"type"`
+}
+
+// Account is an `accountNode`: a named on-chain account layout.
+type Account struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Data TypeNode `json:"data"`
+}
+
+// Instruction is an `instructionNode`; its `arguments[]` become the fields of
+// the generated instruction struct.
+type Instruction struct {
+	Kind      string                `json:"kind"`
+	Name      string                `json:"name"`
+	Arguments []InstructionArgument `json:"arguments"`
+}
+
+// InstructionArgument is one entry of `instructionNode.arguments[]`.
+type InstructionArgument struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Type TypeNode `json:"type"`
+}
+
+// StructFieldNode is one entry of `structTypeNode.fields[]`.
+type StructFieldNode struct {
+	Kind string   `json:"kind"`
+	Name string   `json:"name"`
+	Type TypeNode `json:"type"`
+}
+
+// EnumVariantNode is one entry of `enumTypeNode.variants[]`.
+type EnumVariantNode struct {
+	Kind   string    `json:"kind"` // enumEmptyVariantTypeNode | enumStructVariantTypeNode | enumTupleVariantTypeNode
+	Name   string    `json:"name"`
+	Struct *TypeNode `json:"struct,omitempty"`
+	Tuple  *TypeNode `json:"tuple,omitempty"`
+}
+
+// ValueNode is the `value` of a `constantTypeNode`; only number literals are
+// supported, which is all that `constant<...>` tags can express.
+type ValueNode struct {
+	Kind   string `json:"kind"` // numberValueNode
+	Number int64  `json:"number"`
+}
+
+// CountNode is the `count` of an `arrayTypeNode`.
+type CountNode struct {
+	Kind   string    `json:"kind"` // fixedCountNode | prefixedCountNode | remainderCountNode
+	Value  int       `json:"value,omitempty"`
+	Prefix *TypeNode `json:"prefix,omitempty"`
+}
+
+// TypeNode is a Codama `TypeNode`: a discriminated union keyed by Kind.
+// Only the fields relevant to a given Kind are populated.
+type TypeNode struct {
+	Kind string `json:"kind"`
+
+	// structTypeNode
+	Fields []StructFieldNode `json:"fields,omitempty"`
+
+	// enumTypeNode
+	Variants []EnumVariantNode `json:"variants,omitempty"`
+
+	// optionTypeNode / hiddenPrefixTypeNode / sizePrefixTypeNode: the wrapped payload
+	Item *TypeNode `json:"item,omitempty"`
+	Type *TypeNode `json:"type,omitempty"`
+
+	// optionTypeNode / sizePrefixTypeNode: the discriminant/length prefix format
+	Prefix *TypeNode `json:"prefix,omitempty"`
+
+	// hiddenPrefixTypeNode: constantTypeNode entries written before Type, in order
+	Prefixes []TypeNode `json:"prefixes,omitempty"`
+
+	// fixedSizeTypeNode
+	Size int `json:"size,omitempty"`
+
+	// arrayTypeNode
+	Count *CountNode `json:"count,omitempty"`
+
+	// numberTypeNode
+	Format string `json:"format,omitempty"`
+	Endian string `json:"endian,omitempty"`
+
+	// constantTypeNode
+	Value *ValueNode `json:"value,omitempty"`
+}
@@ -0,0 +1,835 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// codamaEncodeFunc 编码单个 TagNode 描述的修饰符。
+type codamaEncodeFunc func(enc *Encoder, node *TagNode, rv reflect.Value) error
+
+// codamaDecodeFunc 解码单个 TagNode 描述的修饰符。
+type codamaDecodeFunc func(dec *Decoder, node *TagNode, rv reflect.Value) error
+
+// codamaCodec 把一个 Codama 修饰符节点的名字翻译成一对 encode/decode 函数。
+type codamaCodec struct {
+	encode codamaEncodeFunc
+	decode codamaDecodeFunc
+}
+
+// codamaCodecs 是按 TagNode.Name 索引的修饰符分发表，由 Encoder.encodeField /
+// Decoder.decodeField 在 fieldTag.NestedTag 非空时查询，取代此前"只解析不执行"的行为。
+//
+// 它在 init() 里而不是直接在变量初始化表达式里填充：这张表引用的函数会一路
+// 递归回到 codamaEncodeField/codamaDecodeField 本身，若写成字面量会被 Go 的
+// 包级初始化依赖分析误判为初始化环。
+var codamaCodecs map[string]codamaCodec
+
+func init() {
+	codamaCodecs = map[string]codamaCodec{
+		"option":           {codamaEncodeOption, codamaDecodeOption},
+		"coption":          {codamaEncodeCOption, codamaDecodeCOption},
+		"fixed":            {codamaEncodeFixed, codamaDecodeFixed},
+		"prefix":           {codamaEncodePrefixLeaf, codamaDecodePrefixLeaf},
+		"size_prefix":      {codamaEncodeSizePrefix, codamaDecodeSizePrefix},
+		"hidden_prefix":    {codamaEncodeHiddenPrefix, codamaDecodeHiddenPrefix},
+		"constant":         {codamaEncodeConstant, codamaDecodeConstant},
+		"fixed_size":       {codamaEncodeFixedSize, codamaDecodeFixedSize},
+		"pre_offset":       {codamaEncodePreOffset, codamaDecodePreOffset},
+		"remainder_option": {codamaEncodeRemainderOption, codamaDecodeRemainderOption},
+		"array":            {codamaEncodeArray, codamaDecodeArray},
+		"tuple":            {codamaEncodeTuple, codamaDecodeTuple},
+		"struct":           {codamaEncodeStruct, codamaDecodeStruct},
+		"enum":             {codamaEncodeEnum, codamaDecodeEnum},
+		"bytes":            {codamaEncodeBytes, codamaDecodeBytes},
+		"string":           {codamaEncodeString, codamaDecodeString},
+		"bit_array":        {codamaEncodeBitArray, codamaDecodeBitArray},
+	}
+}
+
+// codamaEncodeField 是 Codama AST 解释器的入口，由 Encoder.encodeField 在
+// fieldTag.NestedTag != nil 时调用，取代默认的字段编码。
+func codamaEncodeField(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if node == nil {
+		return fmt.Errorf("bin: codamaEncodeField called with a nil tag node")
+	}
+	codec, ok := codamaCodecs[node.Name]
+	if !ok {
+		return fmt.Errorf("bin: unsupported codama tag modifier %q", node.Name)
+	}
+	return codec.encode(enc, node, rv)
+}
+
+func codamaDecodeField(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if node == nil {
+		return fmt.Errorf("bin: codamaDecodeField called with a nil tag node")
+	}
+	codec, ok := codamaCodecs[node.Name]
+	if !ok {
+		return fmt.Errorf("bin: unsupported codama tag modifier %q", node.Name)
+	}
+	return codec.decode(dec, node, rv)
+}
+
+// codamaEncodeValue 编码一个子树: node 为 nil 表示"没有进一步的修饰符"，
+// 此时交给该字段类型的默认编码逻辑；否则递归进入解释器。
+func codamaEncodeValue(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if node == nil {
+		return enc.Encode(rv.Addr().Interface())
+	}
+	return codamaEncodeField(enc, node, rv)
+}
+
+func codamaDecodeValue(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if node == nil {
+		return dec.Decode(rv.Addr().Interface())
+	}
+	return codamaDecodeField(dec, node, rv)
+}
+
+// codamaItemNode 把一个纯值叶子节点（如裸露的 "u8"）当作"无额外修饰符"处理，
+// 只有真正的修饰符节点才会继续驱动解释器。
+func codamaItemNode(node *TagNode) *TagNode {
+	if node == nil || node.Type != TagTypeModifier {
+		return nil
+	}
+	return node
+}
+
+// codamaPrefixFormat 描述一个长度/存在性前缀应当如何编码: 宽度（字节数）和字节序。
+type codamaPrefixFormat struct {
+	width int
+	order binary.ByteOrder
+}
+
+func (f codamaPrefixFormat) writeUint(enc *Encoder, v uint64) error {
+	switch f.width {
+	case 1:
+		return enc.WriteByte(byte(v))
+	case 2:
+		return enc.WriteUint16(uint16(v), f.order)
+	case 4:
+		return enc.WriteUint32(uint32(v), f.order)
+	case 8:
+		return enc.WriteUint64(v, f.order)
+	default:
+		return fmt.Errorf("bin: unsupported codama prefix width %d", f.width)
+	}
+}
+
+func (f codamaPrefixFormat) readUint(dec *Decoder) (uint64, error) {
+	switch f.width {
+	case 1:
+		b, err := dec.ReadByte()
+		return uint64(b), err
+	case 2:
+		v, err := dec.ReadUint16(f.order)
+		return uint64(v), err
+	case 4:
+		v, err := dec.ReadUint32(f.order)
+		return uint64(v), err
+	case 8:
+		return dec.ReadUint64(f.order)
+	default:
+		return 0, fmt.Errorf("bin: unsupported codama prefix width %d", f.width)
+	}
+}
+
+// numberNodeWidth 返回 Codama number 叶子节点（"u8".."u128", "f32", "f64", ...）的字节宽度。
+func numberNodeWidth(name string) (int, bool) {
+	switch name {
+	case "u8", "i8", "bool":
+		return 1, true
+	case "u16", "i16":
+		return 2, true
+	case "u32", "i32", "f32":
+		return 4, true
+	case "u64", "i64", "f64":
+		return 8, true
+	case "u128", "i128":
+		return 16, true
+	default:
+		return 0, false
+	}
+}
+
+// resolveCodamaPrefix 尝试把一个子节点解释成前缀格式 (prefix<fmt[,endian]>)，
+// 按需穿透一层 fixed<...> 包装。ok 为 false 表示该节点描述的是负载类型本身，
+// 而不是前缀格式。
+func resolveCodamaPrefix(node *TagNode) (codamaPrefixFormat, bool) {
+	if node == nil {
+		return codamaPrefixFormat{}, false
+	}
+	if node.Name == "fixed" && len(node.Children) == 1 {
+		return resolveCodamaPrefix(node.Children[0])
+	}
+	if node.Name != "prefix" || len(node.Children) == 0 {
+		return codamaPrefixFormat{}, false
+	}
+	width, ok := numberNodeWidth(node.Children[0].Name)
+	if !ok {
+		return codamaPrefixFormat{}, false
+	}
+	order := defaultByteOrder
+	if len(node.Children) > 1 {
+		switch node.Children[1].Name {
+		case "be":
+			order = binary.BigEndian
+		case "le":
+			order = binary.LittleEndian
+		}
+	}
+	return codamaPrefixFormat{width: width, order: order}, true
+}
+
+// resolvePrefixAndItem 解析 option<> / size_prefix<> 等节点的子节点列表:
+// 第一个子节点如果能解释成前缀格式，就用它替换默认前缀，负载类型则取自随后的
+// 第二个子节点（若存在）；否则第一个子节点本身就是负载类型，前缀维持默认值。
+func resolvePrefixAndItem(children []*TagNode, fallback codamaPrefixFormat) (codamaPrefixFormat, *TagNode) {
+	if len(children) == 0 {
+		return fallback, nil
+	}
+	if f, ok := resolveCodamaPrefix(children[0]); ok {
+		if len(children) > 1 {
+			return f, children[1]
+		}
+		return f, nil
+	}
+	return fallback, children[0]
+}
+
+// codamaEncodeOption 编码 option<T>: 先写一个存在性标志，再写负载。默认标志宽度
+// 为 1 字节 (u8)；当子节点能被解析为前缀格式 (如 fixed<prefix<u32,le>>) 时，改用
+// 该前缀格式的宽度和字节序。
+func codamaEncodeOption(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	return codamaEncodeOptionLike(enc, node, rv, codamaPrefixFormat{width: 1, order: defaultByteOrder})
+}
+
+func codamaDecodeOption(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	return codamaDecodeOptionLike(dec, node, rv, codamaPrefixFormat{width: 1, order: defaultByteOrder})
+}
+
+// codamaEncodeCOption 编码 coption<T>，与 option 相同，但 Borsh 约定的判别式
+// 默认宽度是 4 字节 (u32) 而不是 1 字节。
+func codamaEncodeCOption(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	return codamaEncodeOptionLike(enc, node, rv, codamaPrefixFormat{width: 4, order: defaultByteOrder})
+}
+
+func codamaDecodeCOption(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	return codamaDecodeOptionLike(dec, node, rv, codamaPrefixFormat{width: 4, order: defaultByteOrder})
+}
+
+func codamaEncodeOptionLike(enc *Encoder, node *TagNode, rv reflect.Value, defaultFormat codamaPrefixFormat) error {
+	format, itemNode := resolvePrefixAndItem(node.Children, defaultFormat)
+	item := codamaItemNode(itemNode)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return format.writeUint(enc, 0)
+		}
+		if err := format.writeUint(enc, 1); err != nil {
+			return err
+		}
+		return codamaEncodeValue(enc, item, rv.Elem())
+	}
+	if err := format.writeUint(enc, 1); err != nil {
+		return err
+	}
+	return codamaEncodeValue(enc, item, rv)
+}
+
+func codamaDecodeOptionLike(dec *Decoder, node *TagNode, rv reflect.Value, defaultFormat codamaPrefixFormat) error {
+	format, itemNode := resolvePrefixAndItem(node.Children, defaultFormat)
+	item := codamaItemNode(itemNode)
+	present, err := format.readUint(dec)
+	if err != nil {
+		return err
+	}
+	if present == 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		return codamaDecodeValue(dec, item, rv.Elem())
+	}
+	return codamaDecodeValue(dec, item, rv)
+}
+
+// codamaEncodeFixed 处理 fixed<T>: 它本身不写入任何字节，只是向上层声明"这棵
+// 子树产生固定宽度的输出"，真正的编码逻辑由子节点给出。它多数情况下会在
+// resolveCodamaPrefix 里被穿透，只有被直接当作字段标签使用时才会走到这里。
+func codamaEncodeFixed(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) != 1 {
+		return fmt.Errorf("bin: fixed<> expects exactly one child, got %d", len(node.Children))
+	}
+	return codamaEncodeValue(enc, codamaItemNode(node.Children[0]), rv)
+}
+
+func codamaDecodeFixed(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) != 1 {
+		return fmt.Errorf("bin: fixed<> expects exactly one child, got %d", len(node.Children))
+	}
+	return codamaDecodeValue(dec, codamaItemNode(node.Children[0]), rv)
+}
+
+// codamaEncodePrefixLeaf 处理直接作为字段标签出现的 prefix<fmt,endian>:
+// 字段本身就是那个长度/判别式数值。
+func codamaEncodePrefixLeaf(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	format, ok := resolveCodamaPrefix(node)
+	if !ok {
+		return fmt.Errorf("bin: invalid prefix<> tag")
+	}
+	return format.writeUint(enc, rv.Uint())
+}
+
+func codamaDecodePrefixLeaf(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	format, ok := resolveCodamaPrefix(node)
+	if !ok {
+		return fmt.Errorf("bin: invalid prefix<> tag")
+	}
+	v, err := format.readUint(dec)
+	if err != nil {
+		return err
+	}
+	rv.SetUint(v)
+	return nil
+}
+
+// codamaEncodeSizePrefix 编码 size_prefix<T>: 先写一个长度前缀，再依次写入切片
+// 的每个元素。T 通常会被解析成前缀格式 (如 fixed<prefix<u32,le>>)；当它描述的
+// 是负载类型而非前缀格式时，长度前缀退化为默认的 u32 小端格式。
+func codamaEncodeSizePrefix(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 {
+		return fmt.Errorf("bin: size_prefix<> requires a child describing the length prefix")
+	}
+	format, item := resolvePrefixAndItem(node.Children, codamaPrefixFormat{width: 4, order: defaultByteOrder})
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Errorf("bin: size_prefix<> can only be applied to a slice or array field, got %s", rv.Kind())
+	}
+	if err := format.writeUint(enc, uint64(rv.Len())); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := codamaEncodeValue(enc, codamaItemNode(item), rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func codamaDecodeSizePrefix(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 {
+		return fmt.Errorf("bin: size_prefix<> requires a child describing the length prefix")
+	}
+	format, item := resolvePrefixAndItem(node.Children, codamaPrefixFormat{width: 4, order: defaultByteOrder})
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("bin: size_prefix<> can only be applied to a slice field, got %s", rv.Kind())
+	}
+	length, err := format.readUint(dec)
+	if err != nil {
+		return err
+	}
+	if err := dec.checkClaimedLength(length); err != nil {
+		return fmt.Errorf("bin: size_prefix<>: %w", err)
+	}
+	out := reflect.MakeSlice(rv.Type(), int(length), int(length))
+	for i := 0; i < int(length); i++ {
+		if err := codamaDecodeValue(dec, codamaItemNode(item), out.Index(i)); err != nil {
+			return err
+		}
+	}
+	rv.Set(out)
+	return nil
+}
+
+// codamaEncodeHiddenPrefix 编码 hidden_prefix<constant<...>, T?>: 先写入一个
+// 不对应任何 Go 字段的哨兵常量，再按 T（缺省为该字段的默认编码）写入真正的值。
+func codamaEncodeHiddenPrefix(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 || node.Children[0].Name != "constant" {
+		return fmt.Errorf("bin: hidden_prefix<> expects a constant<> as its first child")
+	}
+	if err := codamaEncodeConstant(enc, node.Children[0], reflect.Value{}); err != nil {
+		return err
+	}
+	var item *TagNode
+	if len(node.Children) > 1 {
+		item = codamaItemNode(node.Children[1])
+	}
+	return codamaEncodeValue(enc, item, rv)
+}
+
+// codamaDecodeHiddenPrefix 校验常量哨兵值，不匹配时直接返回错误，不会继续
+// 尝试解码真正的字段。
+func codamaDecodeHiddenPrefix(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 || node.Children[0].Name != "constant" {
+		return fmt.Errorf("bin: hidden_prefix<> expects a constant<> as its first child")
+	}
+	if err := codamaDecodeConstant(dec, node.Children[0], reflect.Value{}); err != nil {
+		return err
+	}
+	var item *TagNode
+	if len(node.Children) > 1 {
+		item = codamaItemNode(node.Children[1])
+	}
+	return codamaDecodeValue(dec, item, rv)
+}
+
+// codamaEncodeConstant 写入 constant<[type,]value> 描述的哨兵值。rv 不参与编码
+// (哨兵值不对应任何 Go 字段)，上层如 hidden_prefix 传入零值 reflect.Value 即可。
+func codamaEncodeConstant(enc *Encoder, node *TagNode, _ reflect.Value) error {
+	format, value, err := parseConstantNode(node)
+	if err != nil {
+		return err
+	}
+	return format.writeUint(enc, value)
+}
+
+// codamaDecodeConstant 读取并校验 constant<> 描述的哨兵值，不匹配时返回错误。
+func codamaDecodeConstant(dec *Decoder, node *TagNode, _ reflect.Value) error {
+	format, want, err := parseConstantNode(node)
+	if err != nil {
+		return err
+	}
+	got, err := format.readUint(dec)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("bin: constant<> mismatch: want %d, got %d", want, got)
+	}
+	return nil
+}
+
+// parseConstantNode 解析 constant<value> 或 constant<type,value>，前者的宽度
+// 默认为 1 字节。
+func parseConstantNode(node *TagNode) (codamaPrefixFormat, uint64, error) {
+	switch len(node.Children) {
+	case 1:
+		v, ok := node.Children[0].Value.(int)
+		if !ok {
+			return codamaPrefixFormat{}, 0, fmt.Errorf("bin: constant<> requires a numeric value")
+		}
+		return codamaPrefixFormat{width: 1, order: defaultByteOrder}, uint64(v), nil
+	case 2:
+		width, ok := numberNodeWidth(node.Children[0].Name)
+		if !ok {
+			return codamaPrefixFormat{}, 0, fmt.Errorf("bin: constant<> has unknown type %q", node.Children[0].Name)
+		}
+		v, ok := node.Children[1].Value.(int)
+		if !ok {
+			return codamaPrefixFormat{}, 0, fmt.Errorf("bin: constant<> requires a numeric value")
+		}
+		return codamaPrefixFormat{width: width, order: defaultByteOrder}, uint64(v), nil
+	default:
+		return codamaPrefixFormat{}, 0, fmt.Errorf("bin: constant<> expects 1 or 2 children, got %d", len(node.Children))
+	}
+}
+
+// fixedSizeOf 解析 fixed_size<N> / pre_offset<N> / bit_array<N> 共用的单个数字参数。
+func fixedSizeOf(node *TagNode) (int, error) {
+	if len(node.Children) != 1 {
+		return 0, fmt.Errorf("expects exactly one numeric child, got %d", len(node.Children))
+	}
+	n, ok := node.Children[0].Value.(int)
+	if !ok {
+		return 0, fmt.Errorf("requires a numeric argument")
+	}
+	return n, nil
+}
+
+// codamaEncodeFixedSize 把字符串/字节切片编码成恰好 N 字节: 过长截断，过短用
+// 零字节补齐。
+func codamaEncodeFixedSize(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	size, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: fixed_size<>: %w", err)
+	}
+	raw, err := fixedSizeBytesOf(rv)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, size)
+	copy(buf, raw)
+	return enc.WriteBytes(buf, false)
+}
+
+func codamaDecodeFixedSize(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	size, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: fixed_size<>: %w", err)
+	}
+	raw, err := dec.ReadNBytes(size)
+	if err != nil {
+		return err
+	}
+	return setFixedSizeBytes(rv, raw)
+}
+
+func fixedSizeBytesOf(rv reflect.Value) ([]byte, error) {
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("bin: fixed_size<> can only be applied to a string or []byte field, got %s", rv.Kind())
+}
+
+func setFixedSizeBytes(rv reflect.Value, raw []byte) error {
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(strings.TrimRight(string(raw), "\x00"))
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes(append([]byte(nil), raw...))
+			return nil
+		}
+	}
+	return fmt.Errorf("bin: fixed_size<> can only be applied to a string or []byte field, got %s", rv.Kind())
+}
+
+// codamaEncodePreOffset 编码 pre_offset<N>: 先写入 N 个零字节占位，解码端据此
+// 向前跳过同样的字节数，再写入/读取真正的字段值。
+func codamaEncodePreOffset(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: pre_offset<>: %w", err)
+	}
+	if err := enc.WriteBytes(make([]byte, n), false); err != nil {
+		return err
+	}
+	return codamaEncodeValue(enc, nil, rv)
+}
+
+func codamaDecodePreOffset(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: pre_offset<>: %w", err)
+	}
+	if _, err := dec.ReadNBytes(n); err != nil {
+		return err
+	}
+	return codamaDecodeValue(dec, nil, rv)
+}
+
+// codamaEncodeRemainderOption 编码 remainder_option<>: nil 时不写任何字节，
+// 非 nil 时直接写入负载本身，不附加任何存在性标志——剩余字节是否还有内容，
+// 本身就是那个标志。
+func codamaEncodeRemainderOption(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Ptr {
+		return fmt.Errorf("bin: remainder_option<> can only be applied to a pointer field, got %s", rv.Kind())
+	}
+	if rv.IsNil() {
+		return nil
+	}
+	var item *TagNode
+	if len(node.Children) > 0 {
+		item = codamaItemNode(node.Children[0])
+	}
+	return codamaEncodeValue(enc, item, rv.Elem())
+}
+
+func codamaDecodeRemainderOption(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Ptr {
+		return fmt.Errorf("bin: remainder_option<> can only be applied to a pointer field, got %s", rv.Kind())
+	}
+	if dec.Remaining() == 0 {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	rv.Set(reflect.New(rv.Type().Elem()))
+	var item *TagNode
+	if len(node.Children) > 0 {
+		item = codamaItemNode(node.Children[0])
+	}
+	return codamaDecodeValue(dec, item, rv.Elem())
+}
+
+// codamaEncodeArray 编码 array<item,count>: 按固定元素个数依次编码每个元素。
+func codamaEncodeArray(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) != 2 {
+		return fmt.Errorf("bin: array<> expects exactly two children (item, count), got %d", len(node.Children))
+	}
+	item, countNode := node.Children[0], node.Children[1]
+	count, ok := countNode.Value.(int)
+	if !ok {
+		return fmt.Errorf("bin: array<> requires a numeric count")
+	}
+	if rv.Len() != count {
+		return fmt.Errorf("bin: array<> expects %d elements, field has %d", count, rv.Len())
+	}
+	for i := 0; i < count; i++ {
+		if err := codamaEncodeValue(enc, codamaItemNode(item), rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codamaDecodeArray 解码 array<item,count>；目标为切片时先按 count 分配长度。
+func codamaDecodeArray(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) != 2 {
+		return fmt.Errorf("bin: array<> expects exactly two children (item, count), got %d", len(node.Children))
+	}
+	item, countNode := node.Children[0], node.Children[1]
+	count, ok := countNode.Value.(int)
+	if !ok {
+		return fmt.Errorf("bin: array<> requires a numeric count")
+	}
+	if rv.Kind() == reflect.Slice {
+		rv.Set(reflect.MakeSlice(rv.Type(), count, count))
+	} else if rv.Len() != count {
+		return fmt.Errorf("bin: array<> expects %d elements, field has %d", count, rv.Len())
+	}
+	for i := 0; i < count; i++ {
+		if err := codamaDecodeValue(dec, codamaItemNode(item), rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codamaEncodeTuple 编码 tuple<...>: 结构体字段按声明顺序与子节点一一对应。
+func codamaEncodeTuple(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct || rv.NumField() != len(node.Children) {
+		return fmt.Errorf("bin: tuple<> expects a struct with %d fields, got %s", len(node.Children), rv.Kind())
+	}
+	for i, child := range node.Children {
+		if err := codamaEncodeValue(enc, codamaItemNode(child), rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func codamaDecodeTuple(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct || rv.NumField() != len(node.Children) {
+		return fmt.Errorf("bin: tuple<> expects a struct with %d fields, got %s", len(node.Children), rv.Kind())
+	}
+	for i, child := range node.Children {
+		if err := codamaDecodeValue(dec, codamaItemNode(child), rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codamaEncodeStruct 编码 struct<...>: 修饰符本身只起标注作用，真正的字段布局
+// 仍由内层结构体自己的 bin 标签决定，这里直接复用默认的结构体编码。
+func codamaEncodeStruct(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	return enc.Encode(rv.Addr().Interface())
+}
+
+func codamaDecodeStruct(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	return dec.Decode(rv.Addr().Interface())
+}
+
+// enumVariant 描述 enum<> 的一个带负载变体: 判别式的数值，以及它在 Go 结构体里
+// 对应的指针字段名 (由 codegen 生成为 variant<discriminant,FieldName>)。
+type enumVariant struct {
+	discriminant uint64
+	fieldName    string
+}
+
+// enumVariantsOf 解析 enum<variant<d0,Name0>,...> 的子节点列表。一个没有任何
+// 带负载变体的枚举 (所有变体都是 enumEmptyVariantTypeNode) 生成不出这样的子
+// 节点，这里返回空切片，调用方只写判别式、不再尝试匹配负载。
+func enumVariantsOf(node *TagNode) ([]enumVariant, error) {
+	variants := make([]enumVariant, 0, len(node.Children))
+	for _, child := range node.Children {
+		if child.Name != "variant" || len(child.Children) != 2 {
+			return nil, fmt.Errorf("bin: enum<> expects variant<discriminant,FieldName> children, got %q", child.Name)
+		}
+		d, ok := child.Children[0].Value.(int)
+		if !ok {
+			return nil, fmt.Errorf("bin: enum<> variant<> requires a numeric discriminant")
+		}
+		name, ok := child.Children[1].Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("bin: enum<> variant<> requires a field name")
+		}
+		variants = append(variants, enumVariant{discriminant: uint64(d), fieldName: name})
+	}
+	return variants, nil
+}
+
+// enumVariantByDiscriminant 在 variants 里查找判别式等于 d 的变体，没有则返回
+// nil（对应一个无负载的变体处于激活状态，不需要再读写任何字段）。
+func enumVariantByDiscriminant(variants []enumVariant, d uint64) *enumVariant {
+	for i := range variants {
+		if variants[i].discriminant == d {
+			return &variants[i]
+		}
+	}
+	return nil
+}
+
+// enumDiscriminantUint 把判别式字段（始终是某个无符号/有符号整数类型）读成
+// uint64，便于跟 enumVariant.discriminant 比较。
+func enumDiscriminantUint(rv reflect.Value) (uint64, error) {
+	switch rv.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return rv.Uint(), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return uint64(rv.Int()), nil
+	default:
+		return 0, fmt.Errorf("bin: enum<> discriminant field must be an integer, got %s", rv.Kind())
+	}
+}
+
+// codamaEncodeEnum 编码 enum<...>: rv 是整个枚举结构体（判别式字段 + 每个带
+// 负载变体各一个指针字段）。它只写判别式本身的默认编码，再写出判别式对应的
+// 那一个变体字段——其余变体字段（不管是 nil 还是另有值）完全不碰，修复了之前
+// 把整个结构体交给 encodeStruct、导致非激活变体的 nil 指针报错的问题。
+func codamaEncodeEnum(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct || rv.NumField() == 0 {
+		return fmt.Errorf("bin: enum<> expects a struct with a discriminant field, got %s", rv.Kind())
+	}
+	discriminant := rv.Field(0)
+	if err := enc.Encode(discriminant.Interface()); err != nil {
+		return fmt.Errorf("bin: enum<> discriminant: %w", err)
+	}
+	variants, err := enumVariantsOf(node)
+	if err != nil {
+		return err
+	}
+	d, err := enumDiscriminantUint(discriminant)
+	if err != nil {
+		return err
+	}
+	variant := enumVariantByDiscriminant(variants, d)
+	if variant == nil {
+		return nil
+	}
+	payload := rv.FieldByName(variant.fieldName)
+	if !payload.IsValid() || payload.Kind() != reflect.Ptr {
+		return fmt.Errorf("bin: enum<> variant %q has no matching pointer field", variant.fieldName)
+	}
+	if payload.IsNil() {
+		return fmt.Errorf("bin: enum<> active variant %q has a nil payload", variant.fieldName)
+	}
+	return enc.Encode(payload.Interface())
+}
+
+// codamaDecodeEnum 是 codamaEncodeEnum 的反向操作: 先读判别式，按它清零整个
+// 结构体并写回判别式，再只为匹配的变体分配并解码负载指针，其余变体字段保持
+// nil，不会像之前的 decodeStruct 那样把后续字节错误地当成它们的负载读取。
+func codamaDecodeEnum(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if rv.Kind() != reflect.Struct || rv.NumField() == 0 {
+		return fmt.Errorf("bin: enum<> expects a struct with a discriminant field, got %s", rv.Kind())
+	}
+	discriminantPtr := reflect.New(rv.Field(0).Type())
+	if err := dec.Decode(discriminantPtr.Interface()); err != nil {
+		return fmt.Errorf("bin: enum<> discriminant: %w", err)
+	}
+	variants, err := enumVariantsOf(node)
+	if err != nil {
+		return err
+	}
+	rv.Set(reflect.Zero(rv.Type()))
+	rv.Field(0).Set(discriminantPtr.Elem())
+
+	d, err := enumDiscriminantUint(rv.Field(0))
+	if err != nil {
+		return err
+	}
+	variant := enumVariantByDiscriminant(variants, d)
+	if variant == nil {
+		return nil
+	}
+	payload := rv.FieldByName(variant.fieldName)
+	if !payload.IsValid() || payload.Kind() != reflect.Ptr {
+		return fmt.Errorf("bin: enum<> variant %q has no matching pointer field", variant.fieldName)
+	}
+	newPayload := reflect.New(payload.Type().Elem())
+	if err := dec.Decode(newPayload.Interface()); err != nil {
+		return err
+	}
+	payload.Set(newPayload)
+	return nil
+}
+
+// codamaEncodeBytes 编码 bytes<N>（恰好 N 字节）；bytes<>（没有子节点）则直接
+// 透传给默认编码，由字段自身的长度规则决定。
+func codamaEncodeBytes(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 {
+		return enc.Encode(rv.Addr().Interface())
+	}
+	return codamaEncodeFixedSize(enc, &TagNode{Name: "fixed_size", Children: node.Children}, rv)
+}
+
+func codamaDecodeBytes(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	if len(node.Children) == 0 {
+		return dec.Decode(rv.Addr().Interface())
+	}
+	return codamaDecodeFixedSize(dec, &TagNode{Name: "fixed_size", Children: node.Children}, rv)
+}
+
+// codamaEncodeString 编码 string<N?>，规则与 bytes<N?> 相同，只是通常作用在
+// string 字段上。
+func codamaEncodeString(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	return codamaEncodeBytes(enc, node, rv)
+}
+
+func codamaDecodeString(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	return codamaDecodeBytes(dec, node, rv)
+}
+
+// codamaEncodeBitArray 编码 bit_array<N>: 把长度为 N 的 []bool 打包成
+// ceil(N/8) 个字节，每个字节内按从高位到低位的顺序排列。
+func codamaEncodeBitArray(enc *Encoder, node *TagNode, rv reflect.Value) error {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: bit_array<>: %w", err)
+	}
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() != reflect.Bool || rv.Len() != n {
+		return fmt.Errorf("bin: bit_array<%d> expects a []bool field of length %d", n, n)
+	}
+	buf := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		if rv.Index(i).Bool() {
+			buf[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return enc.WriteBytes(buf, false)
+}
+
+func codamaDecodeBitArray(dec *Decoder, node *TagNode, rv reflect.Value) error {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return fmt.Errorf("bin: bit_array<>: %w", err)
+	}
+	buf, err := dec.ReadNBytes((n + 7) / 8)
+	if err != nil {
+		return err
+	}
+	out := reflect.MakeSlice(rv.Type(), n, n)
+	for i := 0; i < n; i++ {
+		bit := buf[i/8]&(1<<uint(7-i%8)) != 0
+		out.Index(i).SetBool(bit)
+	}
+	rv.Set(out)
+	return nil
+}
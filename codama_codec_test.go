@@ -0,0 +1,317 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeepOptionSizePrefixStruct stacks four modifiers deep:
+// option > size_prefix > fixed > prefix.
+type TestDeepOptionSizePrefixStruct struct {
+	Values *[]uint64 `bin:"option<size_prefix<fixed<prefix<u32,le>>>>"`
+}
+
+func TestDeepNestedOptionSizePrefixTag(t *testing.T) {
+	values := []uint64{7, 8, 9}
+	ts := TestDeepOptionSizePrefixStruct{Values: &values}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	err := enc.Encode(&ts)
+	require.NoError(t, err)
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestDeepOptionSizePrefixStruct
+	err = dec.Decode(&decoded)
+	require.NoError(t, err)
+
+	require.NotNil(t, decoded.Values)
+	assert.Equal(t, values, *decoded.Values)
+
+	// nil option: nothing but the one-byte "not present" discriminant.
+	ts2 := TestDeepOptionSizePrefixStruct{Values: nil}
+	buf2 := new(bytes.Buffer)
+	enc2 := NewBinEncoder(buf2)
+	err = enc2.Encode(&ts2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00}, buf2.Bytes())
+
+	dec2 := NewBinDecoder(buf2.Bytes())
+	var decoded2 TestDeepOptionSizePrefixStruct
+	err = dec2.Decode(&decoded2)
+	require.NoError(t, err)
+	assert.Nil(t, decoded2.Values)
+}
+
+// TestDeepHiddenPrefixOptionStruct stacks four modifiers deep:
+// option > hidden_prefix > {constant, fixed_size}.
+type TestDeepHiddenPrefixOptionStruct struct {
+	Name *string `bin:"option<hidden_prefix<constant<u16,9>,fixed_size<4>>>"`
+}
+
+func TestDeepNestedHiddenPrefixOptionTag(t *testing.T) {
+	name := "Bob"
+	ts := TestDeepHiddenPrefixOptionStruct{Name: &name}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	err := enc.Encode(&ts)
+	require.NoError(t, err)
+
+	expected := []byte{0x01, 0x09, 0x00, 'B', 'o', 'b', 0x00}
+	assert.Equal(t, expected, buf.Bytes())
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestDeepHiddenPrefixOptionStruct
+	err = dec.Decode(&decoded)
+	require.NoError(t, err)
+
+	require.NotNil(t, decoded.Name)
+	assert.Equal(t, "Bob", *decoded.Name)
+
+	ts2 := TestDeepHiddenPrefixOptionStruct{Name: nil}
+	buf2 := new(bytes.Buffer)
+	enc2 := NewBinEncoder(buf2)
+	err = enc2.Encode(&ts2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00}, buf2.Bytes())
+
+	dec2 := NewBinDecoder(buf2.Bytes())
+	var decoded2 TestDeepHiddenPrefixOptionStruct
+	err = dec2.Decode(&decoded2)
+	require.NoError(t, err)
+	assert.Nil(t, decoded2.Name)
+}
+
+// TestOptionBareLeafStruct covers option<T>/coption<T> where T is a bare
+// leaf type (no further modifiers), which codamaItemNode must treat as "no
+// nested tag" so it falls through to the field's default encoding instead
+// of being looked up in codamaCodecs.
+type TestOptionBareLeafStruct struct {
+	A *uint64 `bin:"option<u64>"`
+	B *bool   `bin:"coption<bool>"`
+}
+
+func TestOptionBareLeafTag(t *testing.T) {
+	a := uint64(42)
+	b := true
+	ts := TestOptionBareLeafStruct{A: &a, B: &b}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	err := enc.Encode(&ts)
+	require.NoError(t, err)
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestOptionBareLeafStruct
+	err = dec.Decode(&decoded)
+	require.NoError(t, err)
+
+	require.NotNil(t, decoded.A)
+	require.NotNil(t, decoded.B)
+	assert.Equal(t, a, *decoded.A)
+	assert.Equal(t, b, *decoded.B)
+}
+
+type TestArrayStruct struct {
+	Values [3]uint16 `bin:"array<u16,3>"`
+}
+
+func TestArrayTag(t *testing.T) {
+	ts := TestArrayStruct{Values: [3]uint16{1, 2, 3}}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	err := enc.Encode(&ts)
+	require.NoError(t, err)
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestArrayStruct
+	err = dec.Decode(&decoded)
+	require.NoError(t, err)
+
+	assert.Equal(t, ts.Values, decoded.Values)
+}
+
+type TestBitArrayStruct struct {
+	Flags []bool `bin:"bit_array<5>"`
+}
+
+func TestBitArrayTag(t *testing.T) {
+	ts := TestBitArrayStruct{Flags: []bool{true, false, true, true, false}}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	err := enc.Encode(&ts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte{0b10110000}, buf.Bytes())
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestBitArrayStruct
+	err = dec.Decode(&decoded)
+	require.NoError(t, err)
+
+	assert.Equal(t, ts.Flags, decoded.Flags)
+}
+
+// TestEnumKind, TestEnumTransfer and TestEnumMint mirror the shape
+// codama-gen emits for an enumTypeNode with more than one payload-carrying
+// variant: a discriminant field tagged "enum<variant<d,FieldName>,...>"
+// followed by one pointer field per payload variant.
+type TestEnumKind uint8
+
+const (
+	TestEnumKindInitialize TestEnumKind = iota
+	TestEnumKindTransfer
+	TestEnumKindMint
+)
+
+type TestEnumTransfer struct {
+	Amount uint64
+}
+
+type TestEnumMint struct {
+	To     uint64
+	Amount uint64
+}
+
+type TestEnumStruct struct {
+	Kind     TestEnumKind `bin:"enum<variant<1,Transfer>,variant<2,Mint>>"`
+	Transfer *TestEnumTransfer
+	Mint     *TestEnumMint
+}
+
+// TestEnumTag round-trips all three variants (including the payload-less
+// Initialize) and checks that only the active variant's pointer field ends
+// up non-nil, and that the inactive one is never touched on the wire.
+func TestEnumTag(t *testing.T) {
+	cases := []TestEnumStruct{
+		{Kind: TestEnumKindInitialize},
+		{Kind: TestEnumKindTransfer, Transfer: &TestEnumTransfer{Amount: 42}},
+		{Kind: TestEnumKindMint, Mint: &TestEnumMint{To: 7, Amount: 100}},
+	}
+
+	for _, ts := range cases {
+		buf := new(bytes.Buffer)
+		enc := NewBinEncoder(buf)
+		err := enc.Encode(&ts)
+		require.NoError(t, err)
+
+		dec := NewBinDecoder(buf.Bytes())
+		var decoded TestEnumStruct
+		err = dec.Decode(&decoded)
+		require.NoError(t, err)
+
+		assert.Equal(t, ts, decoded)
+	}
+}
+
+// TestEnumTagSkipsInactiveNilVariant confirms that encoding the payload-less
+// Initialize variant, with both the Transfer and Mint pointers nil, never
+// errors out and writes only the discriminant byte -
+// before the enum<> interpreter dispatched by struct instead of by field,
+// encodeStruct visited every field unconditionally and a nil variant
+// pointer that wasn't the active one produced "bin: cannot encode a nil
+// pointer".
+func TestEnumTagSkipsInactiveNilVariant(t *testing.T) {
+	ts := TestEnumStruct{Kind: TestEnumKindInitialize}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	require.NoError(t, enc.Encode(&ts))
+	assert.Equal(t, []byte{byte(TestEnumKindInitialize)}, buf.Bytes())
+}
+
+// TestOptionWrappedItemTag stacks option<> around an item that itself needs
+// a modifier (fixed_size<>), the shape codama-gen produces for
+// optionTypeNode{item: fixedSizeTypeNode{...}}.
+type TestOptionWrappedItemStruct struct {
+	Label *string `bin:"option<fixed_size<5>>"`
+}
+
+func TestOptionWrappedItemTag(t *testing.T) {
+	label := "ab"
+	ts := TestOptionWrappedItemStruct{Label: &label}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	require.NoError(t, enc.Encode(&ts))
+	// 1-byte presence flag + 5-byte fixed_size payload, "ab" zero-padded.
+	assert.Equal(t, []byte{0x01, 'a', 'b', 0x00, 0x00, 0x00}, buf.Bytes())
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestOptionWrappedItemStruct
+	require.NoError(t, dec.Decode(&decoded))
+	require.NotNil(t, decoded.Label)
+	assert.Equal(t, label, *decoded.Label)
+}
+
+// TestArrayWrappedItemTag mirrors arrayTypeNode{item: fixedSizeTypeNode{...}}:
+// each element of a fixed-count array needs its own fixed_size<> modifier,
+// not the "item" placeholder used when the element needs no modifier.
+type TestArrayWrappedItemStruct struct {
+	Labels [2]string `bin:"array<fixed_size<3>,2>"`
+}
+
+func TestArrayWrappedItemTag(t *testing.T) {
+	ts := TestArrayWrappedItemStruct{Labels: [2]string{"ab", "xyz"}}
+
+	buf := new(bytes.Buffer)
+	enc := NewBinEncoder(buf)
+	require.NoError(t, enc.Encode(&ts))
+	assert.Equal(t, []byte{'a', 'b', 0x00, 'x', 'y', 'z'}, buf.Bytes())
+
+	dec := NewBinDecoder(buf.Bytes())
+	var decoded TestArrayWrappedItemStruct
+	require.NoError(t, dec.Decode(&decoded))
+	assert.Equal(t, ts.Labels, decoded.Labels)
+}
+
+type TestPlainSliceStruct struct {
+	Values []uint64
+}
+
+type TestSizePrefixSliceStruct struct {
+	Values []uint64 `bin:"size_prefix<fixed<prefix<u32,le>>>"`
+}
+
+// TestOversizedLengthPrefixRejected feeds a length prefix (0xFFFFFFF0) far
+// larger than the bytes actually available into both the plain decoder's
+// slice case and size_prefix<>'s, which must reject it instead of handing
+// reflect.MakeSlice a claim it can't back up - an unbacked claim there tries
+// to allocate gigabytes and crashes the process rather than returning an
+// error.
+func TestOversizedLengthPrefixRejected(t *testing.T) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, 0xFFFFFFF0)
+
+	var plain TestPlainSliceStruct
+	err := NewBinDecoder(buf).Decode(&plain)
+	require.Error(t, err)
+
+	var prefixed TestSizePrefixSliceStruct
+	err = NewBinDecoder(buf).Decode(&prefixed)
+	require.Error(t, err)
+}
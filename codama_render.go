@@ -0,0 +1,428 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Canonical renders node back into the minimal `modifier<child,child>` tag
+// string that parseNestedTag accepts, independent of the whitespace or
+// formatting of whatever string it was originally parsed from. Two TagNode
+// trees that are equal produce the same Canonical() string, which makes it
+// useful as a cache key for de-duplicating field codecs and for diffing or
+// logging tags.
+func (node *TagNode) Canonical() string {
+	if node == nil {
+		return ""
+	}
+	if node.Type != TagTypeModifier {
+		return fmt.Sprintf("%v", node.Value)
+	}
+	children := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = child.Canonical()
+	}
+	return node.Name + "<" + strings.Join(children, ",") + ">"
+}
+
+// codamaNodeRenderer converts a single parsed TagNode for a known modifier
+// into the Codama IDL node shape it was derived from.
+type codamaNodeRenderer func(node *TagNode) (map[string]interface{}, error)
+
+// codamaNodeRenderers is the ToCodamaNode counterpart of codamaCodecs: it is
+// keyed by TagNode.Name and queried by renderCodamaNode, so an unrecognized
+// modifier produces a clear "no mapping" error instead of being silently
+// flattened into whatever partial shape its children happen to support.
+var codamaNodeRenderers map[string]codamaNodeRenderer
+
+func init() {
+	codamaNodeRenderers = map[string]codamaNodeRenderer{
+		"option":           renderOptionNode,
+		"coption":          renderCOptionNode,
+		"fixed":            renderFixedNode,
+		"prefix":           renderPrefixLeafNode,
+		"size_prefix":      renderSizePrefixNode,
+		"hidden_prefix":    renderHiddenPrefixNode,
+		"constant":         renderConstantNode,
+		"fixed_size":       renderFixedSizeNode,
+		"pre_offset":       renderPreOffsetNode,
+		"remainder_option": renderRemainderOptionNode,
+		"array":            renderArrayNode,
+		"tuple":            renderTupleNode,
+		"struct":           renderStructNode,
+		"enum":             renderEnumNode,
+		"bytes":            renderBytesNode,
+		"string":           renderStringNode,
+		"bit_array":        renderBitArrayNode,
+	}
+}
+
+// ToCodamaNode renders node into the Codama IDL node (as a JSON-ready map)
+// it was parsed from. It is the reverse of parseNestedTag: where that parser
+// turns IDL-shaped tag strings into a TagNode tree, ToCodamaNode turns the
+// tree back into the `{"kind": "...TypeNode", ...}` shape Codama itself
+// works with.
+func (node *TagNode) ToCodamaNode() (map[string]interface{}, error) {
+	return renderCodamaNode(node)
+}
+
+// renderCodamaNode dispatches a single node to its registered renderer,
+// recursing into leaf number/bool types directly since those have no
+// modifier of their own to look up.
+func renderCodamaNode(node *TagNode) (map[string]interface{}, error) {
+	if node == nil {
+		return nil, fmt.Errorf("bin: cannot render a nil tag node")
+	}
+	if node.Type != TagTypeModifier {
+		return renderLeafNode(node)
+	}
+	renderer, ok := codamaNodeRenderers[node.Name]
+	if !ok {
+		return nil, fmt.Errorf("bin: no Codama IDL node mapping for modifier %q", node.Name)
+	}
+	return renderer(node)
+}
+
+// renderLeafNode renders a bare value node, i.e. a field's item type with no
+// further modifiers, such as the "u64" in "option<u64>".
+func renderLeafNode(node *TagNode) (map[string]interface{}, error) {
+	if node.Type == TagTypeParameter {
+		return nil, fmt.Errorf("bin: %v is a bare parameter, not a type", node.Value)
+	}
+	if node.Name == "bool" {
+		return map[string]interface{}{"kind": "boolTypeNode"}, nil
+	}
+	if _, ok := numberNodeWidth(node.Name); ok {
+		return map[string]interface{}{"kind": "numberTypeNode", "format": node.Name}, nil
+	}
+	return nil, fmt.Errorf("bin: unknown leaf type %q", node.Name)
+}
+
+// renderOptionLikeNode renders option<T>/coption<T> and option<P,T>: a first
+// child that is a prefix format is rendered under "prefix" and the payload
+// item type, if any, is taken from the second child; otherwise the first
+// child is the payload item type. Either way the item is rendered under
+// "item", mirroring resolvePrefixAndItem in the encoder/decoder.
+func renderOptionLikeNode(node *TagNode, kind string) (map[string]interface{}, error) {
+	result := map[string]interface{}{"kind": kind}
+	if len(node.Children) == 0 {
+		return result, nil
+	}
+	item := node.Children[0]
+	if _, isPrefix := resolveCodamaPrefix(item); isPrefix {
+		prefixMap, err := renderCodamaNode(item)
+		if err != nil {
+			return nil, err
+		}
+		result["prefix"] = prefixMap
+		if len(node.Children) < 2 {
+			return result, nil
+		}
+		item = node.Children[1]
+	}
+	itemMap, err := renderCodamaNode(item)
+	if err != nil {
+		return nil, err
+	}
+	result["item"] = itemMap
+	return result, nil
+}
+
+func renderOptionNode(node *TagNode) (map[string]interface{}, error) {
+	return renderOptionLikeNode(node, "optionTypeNode")
+}
+
+func renderCOptionNode(node *TagNode) (map[string]interface{}, error) {
+	return renderOptionLikeNode(node, "coptionTypeNode")
+}
+
+// renderFixedNode passes fixed<T> straight through to T: fixed<> carries no
+// IDL shape of its own, it only tells the interpreter that T is a prefix
+// format rather than a payload type (see resolveCodamaPrefix).
+func renderFixedNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) != 1 {
+		return nil, fmt.Errorf("bin: fixed<> expects exactly one child, got %d", len(node.Children))
+	}
+	return renderCodamaNode(node.Children[0])
+}
+
+// renderPrefixLeafNode renders prefix<format[,endian]> into the
+// numberTypeNode it describes.
+func renderPrefixLeafNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) == 0 {
+		return nil, fmt.Errorf("bin: prefix<> requires a number format child")
+	}
+	formatName := node.Children[0].Name
+	if _, ok := numberNodeWidth(formatName); !ok {
+		return nil, fmt.Errorf("bin: prefix<> has unknown format %q", formatName)
+	}
+	result := map[string]interface{}{"kind": "numberTypeNode", "format": formatName}
+	if len(node.Children) > 1 {
+		switch node.Children[1].Name {
+		case "be", "le":
+			result["endian"] = node.Children[1].Name
+		default:
+			return nil, fmt.Errorf("bin: prefix<> has unknown endian %q", node.Children[1].Name)
+		}
+	}
+	return result, nil
+}
+
+// renderSizePrefixNode renders size_prefix<T>, where T is either a prefix
+// format (the common case) or, more rarely, the payload type itself.
+func renderSizePrefixNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) == 0 {
+		return nil, fmt.Errorf("bin: size_prefix<> requires a child describing the length prefix")
+	}
+	result := map[string]interface{}{"kind": "sizePrefixTypeNode"}
+	if _, isPrefix := resolveCodamaPrefix(node.Children[0]); isPrefix {
+		prefixMap, err := renderCodamaNode(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		result["prefix"] = prefixMap
+		return result, nil
+	}
+	itemMap, err := renderCodamaNode(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	result["type"] = itemMap
+	return result, nil
+}
+
+// renderHiddenPrefixNode renders hidden_prefix<constant<...>, T?>. The
+// constant child is found by name rather than assumed to be Children[0], so
+// a malformed hidden_prefix<> without one produces a clear error.
+//
+// hiddenPrefixTag (codama/generate.go) nests rather than lists when an IDL
+// node has more than one prefix constant: hidden_prefix<constant<A>,
+// hidden_prefix<constant<B>,T>>. Real Codama has no such nesting - a
+// hiddenPrefixTypeNode's "prefixes" is always a single flat array - so this
+// walks down through each nested hidden_prefix<> child, collecting its
+// constant into the same "prefixes" list, until it reaches a child that
+// isn't itself a hidden_prefix<>, which becomes "type".
+func renderHiddenPrefixNode(node *TagNode) (map[string]interface{}, error) {
+	var prefixes []interface{}
+	cur := node
+	for {
+		constantNode := cur.FindChildByName("constant")
+		if constantNode == nil {
+			return nil, fmt.Errorf("bin: hidden_prefix<> requires a constant<> child")
+		}
+		constantMap, err := renderConstantNode(constantNode)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, constantMap)
+
+		if len(cur.Children) <= 1 {
+			break
+		}
+		next := cur.Children[1]
+		if next.Name != "hidden_prefix" {
+			itemMap, err := renderCodamaNode(next)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"kind":     "hiddenPrefixTypeNode",
+				"prefixes": prefixes,
+				"type":     itemMap,
+			}, nil
+		}
+		cur = next
+	}
+	return map[string]interface{}{
+		"kind":     "hiddenPrefixTypeNode",
+		"prefixes": prefixes,
+	}, nil
+}
+
+// renderConstantNode renders constant<value> or constant<type,value>, the
+// former defaulting its type to u8 just like parseConstantNode does.
+func renderConstantNode(node *TagNode) (map[string]interface{}, error) {
+	switch len(node.Children) {
+	case 1:
+		v, ok := node.Children[0].Value.(int)
+		if !ok {
+			return nil, fmt.Errorf("bin: constant<> requires a numeric value")
+		}
+		return constantNodeMap("u8", v), nil
+	case 2:
+		formatName := node.Children[0].Name
+		if _, ok := numberNodeWidth(formatName); !ok {
+			return nil, fmt.Errorf("bin: constant<> has unknown type %q", formatName)
+		}
+		v, ok := node.Children[1].Value.(int)
+		if !ok {
+			return nil, fmt.Errorf("bin: constant<> requires a numeric value")
+		}
+		return constantNodeMap(formatName, v), nil
+	default:
+		return nil, fmt.Errorf("bin: constant<> expects 1 or 2 children, got %d", len(node.Children))
+	}
+}
+
+func constantNodeMap(format string, value int) map[string]interface{} {
+	return map[string]interface{}{
+		"kind": "constantTypeNode",
+		"type": map[string]interface{}{"kind": "numberTypeNode", "format": format},
+		"value": map[string]interface{}{
+			"kind":   "numberValueNode",
+			"number": value,
+		},
+	}
+}
+
+// renderFixedSizeNode renders fixed_size<N>. The tag alone doesn't say
+// whether the wrapped field is a string or []byte, so, matching what the
+// codama generator emits for fixedSizeTypeNode, it assumes a stringTypeNode.
+func renderFixedSizeNode(node *TagNode) (map[string]interface{}, error) {
+	size, err := fixedSizeOf(node)
+	if err != nil {
+		return nil, fmt.Errorf("bin: fixed_size<>: %w", err)
+	}
+	return map[string]interface{}{
+		"kind": "fixedSizeTypeNode",
+		"size": size,
+		"type": map[string]interface{}{"kind": "stringTypeNode"},
+	}, nil
+}
+
+// renderPreOffsetNode renders pre_offset<N>. There is no real Codama
+// equivalent for this modifier yet, so it uses a preOffsetTypeNode shape
+// consistent with the rest of this package's registry.
+func renderPreOffsetNode(node *TagNode) (map[string]interface{}, error) {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return nil, fmt.Errorf("bin: pre_offset<>: %w", err)
+	}
+	return map[string]interface{}{"kind": "preOffsetTypeNode", "offset": n}, nil
+}
+
+// renderRemainderOptionNode renders remainder_option<T?>.
+func renderRemainderOptionNode(node *TagNode) (map[string]interface{}, error) {
+	result := map[string]interface{}{"kind": "remainderOptionTypeNode"}
+	if len(node.Children) > 0 {
+		itemMap, err := renderCodamaNode(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		result["item"] = itemMap
+	}
+	return result, nil
+}
+
+// renderArrayNode renders array<item,count> into an arrayTypeNode with a
+// fixedCountNode, the only count kind array<> can express.
+func renderArrayNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) != 2 {
+		return nil, fmt.Errorf("bin: array<> expects exactly two children (item, count), got %d", len(node.Children))
+	}
+	itemMap, err := renderCodamaNode(node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	count, ok := node.Children[1].Value.(int)
+	if !ok {
+		return nil, fmt.Errorf("bin: array<> requires a numeric count")
+	}
+	return map[string]interface{}{
+		"kind": "arrayTypeNode",
+		"item": itemMap,
+		"count": map[string]interface{}{
+			"kind":  "fixedCountNode",
+			"value": count,
+		},
+	}, nil
+}
+
+// renderTupleNode renders tuple<...> into a tupleTypeNode, the Codama shape
+// for a fixed, heterogeneous sequence of items.
+func renderTupleNode(node *TagNode) (map[string]interface{}, error) {
+	items := make([]interface{}, len(node.Children))
+	for i, child := range node.Children {
+		itemMap, err := renderCodamaNode(child)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = itemMap
+	}
+	return map[string]interface{}{"kind": "tupleTypeNode", "items": items}, nil
+}
+
+// renderStructNode renders struct<>, which defers entirely to the wrapped
+// field's own default encoding (see codamaEncodeStruct) and so carries no
+// layout information of its own beyond its kind. renderEnumNode renders
+// enum<> as a bare enumTypeNode: the variant<discriminant,FieldName>
+// children that codamaEncodeEnum acts on are not rendered.
+func renderStructNode(node *TagNode) (map[string]interface{}, error) {
+	return map[string]interface{}{"kind": "structTypeNode"}, nil
+}
+
+func renderEnumNode(node *TagNode) (map[string]interface{}, error) {
+	return map[string]interface{}{"kind": "enumTypeNode"}, nil
+}
+
+// renderBytesNode renders bytes<> (a bare byte slice) or bytes<N> (an N-byte
+// fixed-size wrapper around one).
+func renderBytesNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) == 0 {
+		return map[string]interface{}{"kind": "bytesTypeNode"}, nil
+	}
+	size, err := fixedSizeOf(node)
+	if err != nil {
+		return nil, fmt.Errorf("bin: bytes<>: %w", err)
+	}
+	return map[string]interface{}{
+		"kind": "fixedSizeTypeNode",
+		"size": size,
+		"type": map[string]interface{}{"kind": "bytesTypeNode"},
+	}, nil
+}
+
+// renderStringNode renders string<> (a bare string) or string<N> (an N-byte
+// fixed-size wrapper around one), mirroring renderBytesNode.
+func renderStringNode(node *TagNode) (map[string]interface{}, error) {
+	if len(node.Children) == 0 {
+		return map[string]interface{}{"kind": "stringTypeNode"}, nil
+	}
+	size, err := fixedSizeOf(node)
+	if err != nil {
+		return nil, fmt.Errorf("bin: string<>: %w", err)
+	}
+	return map[string]interface{}{
+		"kind": "fixedSizeTypeNode",
+		"size": size,
+		"type": map[string]interface{}{"kind": "stringTypeNode"},
+	}, nil
+}
+
+// renderBitArrayNode renders bit_array<N>. Like pre_offset<>, there is no
+// real Codama equivalent, so it uses a bitArrayTypeNode shape consistent
+// with the rest of this registry.
+func renderBitArrayNode(node *TagNode) (map[string]interface{}, error) {
+	n, err := fixedSizeOf(node)
+	if err != nil {
+		return nil, fmt.Errorf("bin: bit_array<>: %w", err)
+	}
+	return map[string]interface{}{"kind": "bitArrayTypeNode", "size": n}, nil
+}
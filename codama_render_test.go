@@ -0,0 +1,140 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// codamaNodeTags lists one representative tag per supported modifier; it is
+// shared between TestCanonicalRoundTrip and TestToCodamaNodeGolden so both
+// exercise the same set.
+var codamaNodeTags = []string{
+	"option<u64>",
+	"coption<u64>",
+	"fixed<prefix<u32,le>>",
+	"prefix<u32,le>",
+	"size_prefix<fixed<prefix<u32,le>>>",
+	"hidden_prefix<constant<u64,42>,fixed_size<5>>",
+	"hidden_prefix<constant<u64,42>,hidden_prefix<constant<u32,7>,fixed_size<5>>>",
+	"constant<u64,42>",
+	"fixed_size<5>",
+	"pre_offset<4>",
+	"remainder_option<u64>",
+	"array<u16,3>",
+	"tuple<u8,u16>",
+	"struct<>",
+	"enum<>",
+	"bytes<4>",
+	"string<8>",
+	"bit_array<5>",
+}
+
+// TestCanonicalRoundTrip parses each tag, renders it back with Canonical(),
+// reparses that string, and checks the two ASTs are equal.
+func TestCanonicalRoundTrip(t *testing.T) {
+	for _, tag := range codamaNodeTags {
+		t.Run(tag, func(t *testing.T) {
+			node, err := parseNestedTag(tag)
+			require.NoError(t, err)
+
+			reparsed, err := parseNestedTag(node.Canonical())
+			require.NoError(t, err)
+
+			require.Equal(t, node, reparsed)
+		})
+	}
+}
+
+// TestToCodamaNodeGolden parses each tag, renders it with ToCodamaNode, and
+// compares the result (round-tripped through JSON, since that's the form
+// the golden fixture is stored in) against testdata/codama_nodes.golden.json.
+func TestToCodamaNodeGolden(t *testing.T) {
+	raw, err := os.ReadFile("testdata/codama_nodes.golden.json")
+	require.NoError(t, err)
+
+	var golden map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &golden))
+
+	for _, tag := range codamaNodeTags {
+		t.Run(tag, func(t *testing.T) {
+			want, ok := golden[tag]
+			require.Truef(t, ok, "no golden fixture for tag %q", tag)
+
+			node, err := parseNestedTag(tag)
+			require.NoError(t, err)
+
+			got, err := node.ToCodamaNode()
+			require.NoError(t, err)
+
+			gotJSON, err := json.Marshal(got)
+			require.NoError(t, err)
+			var gotGeneric interface{}
+			require.NoError(t, json.Unmarshal(gotJSON, &gotGeneric))
+
+			require.Equal(t, want, gotGeneric)
+		})
+	}
+}
+
+// TestCodamaNodeTagsEncodeDecode round-trips the option<u64>/coption<u64>
+// entries of codamaNodeTags through NewBinEncoder/NewBinDecoder, not just
+// ToCodamaNode: a tag is only a "supported" fixture in
+// TestToCodamaNodeGolden if the codec can actually encode and decode it,
+// which a bare leaf payload (no further modifiers) previously could not.
+func TestCodamaNodeTagsEncodeDecode(t *testing.T) {
+	cases := []string{"option<u64>", "coption<u64>"}
+
+	for _, tag := range cases {
+		t.Run(tag, func(t *testing.T) {
+			structType := reflect.StructOf([]reflect.StructField{
+				{Name: "F", Type: reflect.TypeOf((*uint64)(nil)), Tag: reflect.StructTag(fmt.Sprintf(`bin:%q`, tag))},
+			})
+
+			value := uint64(7)
+			original := reflect.New(structType)
+			original.Elem().Field(0).Set(reflect.ValueOf(&value))
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, NewBinEncoder(buf).Encode(original.Interface()))
+
+			decoded := reflect.New(structType)
+			require.NoError(t, NewBinDecoder(buf.Bytes()).Decode(decoded.Interface()))
+
+			require.Equal(t, original.Elem().Field(0).Interface(), decoded.Elem().Field(0).Interface())
+		})
+	}
+}
+
+// TestToCodamaNodeUnknownModifier checks that an unrecognized modifier name
+// produces an explicit error instead of silently flattening into whatever
+// partial shape its children happen to support.
+func TestToCodamaNodeUnknownModifier(t *testing.T) {
+	node, err := parseNestedTag("not_a_real_modifier<u8>")
+	require.NoError(t, err)
+
+	_, err = node.ToCodamaNode()
+	require.Error(t, err)
+}
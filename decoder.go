@@ -0,0 +1,289 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Decoder deserializes the binary wire format described by `bin:"..."`
+// struct tags back into Go values.
+type Decoder struct {
+	data []byte
+	pos  int
+}
+
+// NewBinDecoder returns a Decoder reading from data.
+func NewBinDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Remaining returns the number of unread bytes left in the input.
+func (d *Decoder) Remaining() int {
+	return len(d.data) - d.pos
+}
+
+// checkClaimedLength rejects a slice length prefix that claims more elements
+// than there are bytes left to read; strings and []byte need no such check,
+// since ReadNBytes refuses a length beyond the remaining input before
+// anything is allocated. Every element of a type with a non-zero wire size
+// takes at least one byte, so this is a valid upper bound for such element
+// types; a slice of a zero-size type such as struct{} is also rejected once
+// its length exceeds the remaining bytes. Without it, a hostile length
+// prefix like 0xFFFFFFF0 makes reflect.MakeSlice try to allocate gigabytes
+// and kills the process with an unrecoverable out-of-memory fault instead of
+// a catchable error — a guaranteed DoS against a decoder whose whole job is
+// reading untrusted on-chain data.
+func (d *Decoder) checkClaimedLength(n uint64) error {
+	if n > uint64(d.Remaining()) {
+		return fmt.Errorf("bin: claimed length %d exceeds %d remaining bytes", n, d.Remaining())
+	}
+	return nil
+}
+
+func (d *Decoder) ReadNBytes(n int) ([]byte, error) {
+	if n < 0 || d.Remaining() < n {
+		return nil, fmt.Errorf("bin: not enough bytes to read %d bytes, only %d remaining", n, d.Remaining())
+	}
+	out := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return out, nil
+}
+
+func (d *Decoder) ReadByte() (byte, error) {
+	b, err := d.ReadNBytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) ReadBool() (bool, error) {
+	b, err := d.ReadByte()
+	return b != 0, err
+}
+
+func (d *Decoder) ReadUint16(order binary.ByteOrder) (uint16, error) {
+	b, err := d.ReadNBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint16(b), nil
+}
+
+func (d *Decoder) ReadUint32(order binary.ByteOrder) (uint32, error) {
+	b, err := d.ReadNBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint32(b), nil
+}
+
+func (d *Decoder) ReadUint64(order binary.ByteOrder) (uint64, error) {
+	b, err := d.ReadNBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint64(b), nil
+}
+
+// Decode reads into v, which must be a non-nil pointer.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bin: Decode requires a non-nil pointer, got %s", rv.Kind())
+	}
+	return d.decodeValue(rv.Elem())
+}
+
+func (d *Decoder) decodeValue(rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+		return d.decodeStruct(rv)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.decodeValue(rv.Elem())
+	case reflect.Bool:
+		v, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+		rv.SetBool(v)
+		return nil
+	case reflect.Uint8:
+		v, err := d.ReadByte()
+		if err != nil {
+			return err
+		}
+		rv.SetUint(uint64(v))
+		return nil
+	case reflect.Int8:
+		v, err := d.ReadByte()
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(int8(v)))
+		return nil
+	case reflect.Uint16:
+		v, err := d.ReadUint16(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetUint(uint64(v))
+		return nil
+	case reflect.Int16:
+		v, err := d.ReadUint16(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(int16(v)))
+		return nil
+	case reflect.Uint32:
+		v, err := d.ReadUint32(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetUint(uint64(v))
+		return nil
+	case reflect.Int32:
+		v, err := d.ReadUint32(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(int32(v)))
+		return nil
+	case reflect.Uint64:
+		v, err := d.ReadUint64(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetUint(v)
+		return nil
+	case reflect.Int64:
+		v, err := d.ReadUint64(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(v))
+		return nil
+	case reflect.Float32:
+		v, err := d.ReadUint32(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(float64(math.Float32frombits(v)))
+		return nil
+	case reflect.Float64:
+		v, err := d.ReadUint64(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(math.Float64frombits(v))
+		return nil
+	case reflect.String:
+		l, err := d.ReadUint32(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		b, err := d.ReadNBytes(int(l))
+		if err != nil {
+			return err
+		}
+		rv.SetString(string(b))
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			l, err := d.ReadUint32(defaultByteOrder)
+			if err != nil {
+				return err
+			}
+			b, err := d.ReadNBytes(int(l))
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		l, err := d.ReadUint32(defaultByteOrder)
+		if err != nil {
+			return err
+		}
+		if err := d.checkClaimedLength(uint64(l)); err != nil {
+			return err
+		}
+		out := reflect.MakeSlice(rv.Type(), int(l), int(l))
+		for i := 0; i < int(l); i++ {
+			if err := d.decodeValue(out.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(out)
+		return nil
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := d.decodeValue(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("bin: decode: unsupported type %s", rv.Kind())
+	}
+}
+
+func (d *Decoder) decodeStruct(rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		structField := rt.Field(i)
+		tag := parseFieldTag(structField.Tag)
+		if tag.Skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		// See the matching comment in Encoder.encodeStruct: a discriminant
+		// field tagged "enum<...>" hands the whole struct to
+		// codamaDecodeEnum, which reads the discriminant and allocates only
+		// the matching variant field, so the remaining fields must not be
+		// decoded by this loop.
+		if tag.NestedTag != nil && tag.NestedTag.Name == "enum" {
+			return codamaDecodeEnum(d, tag.NestedTag, rv)
+		}
+		if err := d.decodeField(fv, tag); err != nil {
+			return fmt.Errorf("bin: error while decoding %q field: %w", structField.Name, err)
+		}
+	}
+	return nil
+}
+
+// decodeField is the decode counterpart of Encoder.encodeField: a field
+// whose tag was parsed into a NestedTag is handed off to the Codama AST
+// interpreter instead of the default decoding below.
+func (d *Decoder) decodeField(rv reflect.Value, tag *fieldTag) error {
+	if tag.NestedTag != nil {
+		return codamaDecodeField(d, tag.NestedTag, rv)
+	}
+	return d.decodeValue(rv)
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 github.com/gagliardetto
+// This file has been modified by github.com/gagliardetto
+//
+// Copyright 2020 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// defaultByteOrder is the byte order a field is encoded/decoded with when
+// its tag doesn't request a different one.
+var defaultByteOrder binary.ByteOrder = binary.LittleEndian
+
+// Encoder serializes Go values into the binary wire format described by
+// `bin:"..."` struct tags.
+type Encoder struct {
+	writer io.Writer
+	count  int
+}
+
+// NewBinEncoder returns an Encoder that writes to w.
+func NewBinEncoder(w io.Writer) *Encoder {
+	return &Encoder{writer: w}
+}
+
+// Written returns the number of bytes written so far.
+func (e *Encoder) Written() int {
+	return e.count
+}
+
+func (e *Encoder) Write(b []byte) (int, error) {
+	n, err := e.writer.Write(b)
+	e.count += n
+	return n, err
+}
+
+func (e *Encoder) WriteByte(b byte) error {
+	_, err := e.Write([]byte{b})
+	return err
+}
+
+// WriteBytes writes b as-is, optionally preceded by its length as a u32.
+func (e *Encoder) WriteBytes(b []byte, writeLength bool) error {
+	if writeLength {
+		if err := e.WriteUint32(uint32(len(b)), defaultByteOrder); err != nil {
+			return err
+		}
+	}
+	_, err := e.Write(b)
+	return err
+}
+
+func (e *Encoder) WriteBool(b bool) error {
+	if b {
+		return e.WriteByte(1)
+	}
+	return e.WriteByte(0)
+}
+
+func (e *Encoder) WriteUint16(v uint16, order binary.ByteOrder) error {
+	buf := make([]byte, 2)
+	order.PutUint16(buf, v)
+	_, err := e.Write(buf)
+	return err
+}
+
+func (e *Encoder) WriteUint32(v uint32, order binary.ByteOrder) error {
+	buf := make([]byte, 4)
+	order.PutUint32(buf, v)
+	_, err := e.Write(buf)
+	return err
+}
+
+func (e *Encoder) WriteUint64(v uint64, order binary.ByteOrder) error {
+	buf := make([]byte, 8)
+	order.PutUint64(buf, v)
+	_, err := e.Write(buf)
+	return err
+}
+
+// Encode writes v, which must be a struct, a pointer to one, or a supported
+// scalar/slice/array type.
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	return e.encodeValue(rv)
+}
+
+func (e *Encoder) encodeValue(rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+		return e.encodeStruct(rv)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return fmt.Errorf("bin: cannot encode a nil pointer")
+		}
+		return e.encodeValue(rv.Elem())
+	case reflect.Bool:
+		return e.WriteBool(rv.Bool())
+	case reflect.Uint8:
+		return e.WriteByte(byte(rv.Uint()))
+	case reflect.Int8:
+		return e.WriteByte(byte(rv.Int()))
+	case reflect.Uint16:
+		return e.WriteUint16(uint16(rv.Uint()), defaultByteOrder)
+	case reflect.Int16:
+		return e.WriteUint16(uint16(rv.Int()), defaultByteOrder)
+	case reflect.Uint32:
+		return e.WriteUint32(uint32(rv.Uint()), defaultByteOrder)
+	case reflect.Int32:
+		return e.WriteUint32(uint32(rv.Int()), defaultByteOrder)
+	case reflect.Uint64:
+		return e.WriteUint64(rv.Uint(), defaultByteOrder)
+	case reflect.Int64:
+		return e.WriteUint64(uint64(rv.Int()), defaultByteOrder)
+	case reflect.Float32:
+		return e.WriteUint32(math.Float32bits(float32(rv.Float())), defaultByteOrder)
+	case reflect.Float64:
+		return e.WriteUint64(math.Float64bits(rv.Float()), defaultByteOrder)
+	case reflect.String:
+		return e.WriteBytes([]byte(rv.String()), true)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return e.WriteBytes(rv.Bytes(), true)
+		}
+		if err := e.WriteUint32(uint32(rv.Len()), defaultByteOrder); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.encodeValue(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.encodeValue(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("bin: encode: unsupported type %s", rv.Kind())
+	}
+}
+
+func (e *Encoder) encodeStruct(rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		structField := rt.Field(i)
+		tag := parseFieldTag(structField.Tag)
+		if tag.Skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if !fv.CanInterface() {
+			continue
+		}
+		// A discriminant field tagged "enum<...>" (as codama-gen emits for an
+		// enum with payload variants) hands the whole struct to
+		// codamaEncodeEnum instead of being encoded as an ordinary field: it
+		// writes the discriminant and only the one variant field it selects,
+		// so the remaining variant fields must not be visited by this loop.
+		if tag.NestedTag != nil && tag.NestedTag.Name == "enum" {
+			return codamaEncodeEnum(e, tag.NestedTag, rv)
+		}
+		if err := e.encodeField(fv, tag); err != nil {
+			return fmt.Errorf("bin: error while encoding %q field: %w", structField.Name, err)
+		}
+	}
+	return nil
+}
+
+// encodeField encodes a single struct field. A field whose tag was parsed
+// into a NestedTag (e.g. "option<fixed<prefix<u32,le>>>") is handed off to
+// the Codama AST interpreter instead of the default encoding below.
+func (e *Encoder) encodeField(rv reflect.Value, tag *fieldTag) error {
+	if tag.NestedTag != nil {
+		return codamaEncodeField(e, tag.NestedTag, rv)
+	}
+	return e.encodeValue(rv)
+}